@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Emitter writes a stream of Records to an output format. main selects an
+// implementation based on -format; each owns whatever framing its format
+// needs (CSV's header row, NDJSON's one-object-per-line, bin's
+// length-delimited records) instead of main knowing about any of them.
+type Emitter interface {
+	// Header writes any leading, format-specific framing. Called once,
+	// before the first Emit.
+	Header() error
+	Emit(record Record) error
+	// Devices writes the -devices filesystem summary, in whatever shape
+	// fits the format. Called once, after the last Emit, only when
+	// -devices produced any summaries. Formats that can't represent a
+	// second kind of row alongside Records (bin) report an error instead
+	// of silently corrupting the record stream.
+	Devices(summaries []deviceSummary) error
+	// Close flushes buffered output. Called once, after the last Emit.
+	Close() error
+}
+
+// newEmitter builds the Emitter named by format ("csv", "jsonl" or "bin"; ""
+// defaults to "csv"), writing to w. The stat/statx/hash flags tell the CSV
+// emitter which columns to include; the other formats always carry every
+// field, since they're self-describing.
+func newEmitter(format string, w io.Writer, finder *Finder) (Emitter, error) {
+	switch format {
+	case "", "csv":
+		return newCSVEmitter(w, finder.stat, finder.statx, finder.hash != ""), nil
+	case "jsonl":
+		return newJSONLEmitter(w), nil
+	case "bin":
+		return newBinEmitter(w), nil
+	default:
+		return nil, fmt.Errorf("invalid -format %q (want csv, jsonl or bin)", format)
+	}
+}
+
+// csvEmitter writes fastfind's CSV output: a header row naming only the
+// columns the active flags populate, and one data row per record with
+// exactly those columns plus a trailing Error column. Trailing empty fields
+// are kept, so every row has as many fields as the header.
+type csvEmitter struct {
+	writer    *csv.Writer
+	withStat  bool
+	withStatx bool
+	withHash  bool
+	row       []string
+}
+
+func newCSVEmitter(w io.Writer, withStat, withStatx, withHash bool) *csvEmitter {
+	return &csvEmitter{
+		writer:    csv.NewWriter(w),
+		withStat:  withStat,
+		withStatx: withStatx,
+		withHash:  withHash,
+		row:       make([]string, 0, 16),
+	}
+}
+
+func (e *csvEmitter) Header() error {
+	row := e.row[:0]
+	row = append(row, "Path", "Type")
+	if e.withStat {
+		row = append(row, "Size", "MTime")
+	}
+	if e.withStatx {
+		row = append(row, "BTime", "CTime", "Nlink", "Ino", "ReparseTag")
+	}
+	if e.withHash {
+		row = append(row, "Hash")
+	}
+	row = append(row, "Error")
+	return e.writer.Write(row)
+}
+
+func (e *csvEmitter) Emit(record Record) error {
+	row := e.row[:0]
+
+	row = append(row, record.Path, string(record.Type))
+
+	if e.withStat {
+		if len(record.Errors) == 0 && record.Type == 'f' {
+			row = append(row, strconv.FormatInt(record.Size, 10))
+		} else {
+			row = append(row, "")
+		}
+		row = append(row, formatTime(record.MTime))
+	}
+
+	if e.withStatx {
+		row = append(row, formatTime(record.BTime))
+		row = append(row, formatTime(record.CTime))
+		if record.Nlink != 0 {
+			row = append(row, strconv.FormatUint(record.Nlink, 10))
+		} else {
+			row = append(row, "")
+		}
+		if record.Ino != 0 {
+			row = append(row, strconv.FormatUint(record.Ino, 10))
+		} else {
+			row = append(row, "")
+		}
+		if record.ReparseTag != 0 {
+			row = append(row, strconv.FormatUint(uint64(record.ReparseTag), 10))
+		} else {
+			row = append(row, "")
+		}
+	}
+
+	if e.withHash {
+		row = append(row, record.Hash)
+	}
+
+	row = append(row, joinErrors(record.Errors))
+
+	e.row = row
+	return e.writer.Write(row)
+}
+
+// Devices writes the -devices summary as its own little CSV table, preceded
+// by a blank line so it reads as a separate section from the record rows.
+func (e *csvEmitter) Devices(summaries []deviceSummary) error {
+	if err := e.writer.Write(nil); err != nil {
+		return err
+	}
+	if err := e.writer.Write([]string{"Device", "Root", "FSType"}); err != nil {
+		return err
+	}
+	for _, summary := range summaries {
+		row := []string{strconv.FormatUint(summary.ID, 10), summary.Root, summary.FSType}
+		if err := e.writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *csvEmitter) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(timeFormat)
+}
+
+// jsonlEmitter writes one JSON object per record (NDJSON), with the same
+// field names on every line regardless of which flags were passed, so a
+// downstream reader (jq, duckdb, ...) never has to deal with a ragged
+// schema the way CSV's conditional columns would produce.
+type jsonlEmitter struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func newJSONLEmitter(w io.Writer) *jsonlEmitter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonlEmitter{w: w, enc: enc}
+}
+
+// jsonRecord mirrors Record with stable, lowercase field names and RFC 3339
+// timestamps; zero times are omitted rather than emitted as the Unix epoch.
+type jsonRecord struct {
+	Path       string     `json:"path"`
+	Type       string     `json:"type"`
+	Size       int64      `json:"size"`
+	MTime      *time.Time `json:"mtime,omitempty"`
+	BTime      *time.Time `json:"btime,omitempty"`
+	CTime      *time.Time `json:"ctime,omitempty"`
+	Nlink      uint64     `json:"nlink,omitempty"`
+	Ino        uint64     `json:"ino,omitempty"`
+	ReparseTag uint32     `json:"reparse_tag,omitempty"`
+	Hash       string     `json:"hash,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func toJSONRecord(record Record) jsonRecord {
+	j := jsonRecord{
+		Path:       record.Path,
+		Type:       string(record.Type),
+		Size:       record.Size,
+		Nlink:      record.Nlink,
+		Ino:        record.Ino,
+		ReparseTag: record.ReparseTag,
+		Hash:       record.Hash,
+		Error:      joinErrors(record.Errors),
+	}
+	if !record.MTime.IsZero() {
+		t := record.MTime.UTC()
+		j.MTime = &t
+	}
+	if !record.BTime.IsZero() {
+		t := record.BTime.UTC()
+		j.BTime = &t
+	}
+	if !record.CTime.IsZero() {
+		t := record.CTime.UTC()
+		j.CTime = &t
+	}
+	return j
+}
+
+func (e *jsonlEmitter) Header() error { return nil }
+
+func (e *jsonlEmitter) Emit(record Record) error {
+	return e.enc.Encode(toJSONRecord(record))
+}
+
+// jsonDeviceSummary is one -devices line. It has no fields in common with
+// jsonRecord, so a reader distinguishes the two kinds of line by which keys
+// are present (e.g. "device_id") rather than by a shared discriminant field.
+type jsonDeviceSummary struct {
+	DeviceID uint64 `json:"device_id"`
+	Root     string `json:"root"`
+	FSType   string `json:"fstype,omitempty"`
+}
+
+func (e *jsonlEmitter) Devices(summaries []deviceSummary) error {
+	for _, summary := range summaries {
+		if err := e.enc.Encode(jsonDeviceSummary{DeviceID: summary.ID, Root: summary.Root, FSType: summary.FSType}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonlEmitter) Close() error { return nil }
+
+// binEmitter writes each record as a fixed-layout binary payload prefixed
+// with its own big-endian uint32 length, giving downstream tools a
+// length-delimited stream they can split without scanning for a separator
+// (and without CSV's quoting/escaping cost on Windows paths). Like jsonl, it
+// always carries every field rather than varying its layout with the flags.
+//
+// This is a bespoke framing private to fastfind, not protobuf, flatbuffers
+// or Parquet: there's no generated schema a tool like duckdb or
+// clickhouse-local could load, so -format bin is meant for a reader built
+// against this file, not ad-hoc ingestion. -format jsonl is the format to
+// reach for when that kind of off-the-shelf tooling matters.
+type binEmitter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func newBinEmitter(w io.Writer) *binEmitter {
+	return &binEmitter{w: bufio.NewWriter(w)}
+}
+
+func (e *binEmitter) Header() error { return nil }
+
+func (e *binEmitter) Emit(record Record) error {
+	e.buf = e.buf[:0]
+	e.buf = appendString(e.buf, record.Path)
+	e.buf = append(e.buf, byte(record.Type))
+	e.buf = appendUint64(e.buf, uint64(record.Size))
+	e.buf = appendTime(e.buf, record.MTime)
+	e.buf = appendTime(e.buf, record.BTime)
+	e.buf = appendTime(e.buf, record.CTime)
+	e.buf = appendUint64(e.buf, record.Nlink)
+	e.buf = appendUint64(e.buf, record.Ino)
+	e.buf = appendUint32(e.buf, record.ReparseTag)
+	e.buf = appendString(e.buf, record.Hash)
+	e.buf = appendString(e.buf, joinErrors(record.Errors))
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(e.buf)))
+	if _, err := e.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// Devices refuses rather than writes: bin's frames are fixed-layout Records
+// with no room for a second kind of row, so splicing a device summary in
+// would corrupt the stream for any reader expecting one. Pass -devices with
+// -format csv or -format jsonl instead.
+func (e *binEmitter) Devices(summaries []deviceSummary) error {
+	if len(summaries) == 0 {
+		return nil
+	}
+	return fmt.Errorf("-devices is not supported with -format bin (it has no framing for a non-Record row); use -format csv or -format jsonl")
+}
+
+func (e *binEmitter) Close() error { return e.w.Flush() }
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+func appendTime(buf []byte, t time.Time) []byte {
+	var nanos int64
+	if !t.IsZero() {
+		nanos = t.UnixNano()
+	}
+	return appendUint64(buf, uint64(nanos))
+}
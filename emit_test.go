@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVEmitterHeaderAndRow(t *testing.T) {
+	var buf bytes.Buffer
+	e := newCSVEmitter(&buf, true, true, true)
+	if err := e.Header(); err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := e.Emit(Record{Path: "a/b", Type: 'f', Size: 42, MTime: mtime}); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header + 1 row, got %d lines: %q", len(lines), buf.String())
+	}
+	wantHeader := "Path,Type,Size,MTime,BTime,CTime,Nlink,Ino,ReparseTag,Hash,Error"
+	if lines[0] != wantHeader {
+		t.Errorf("header = %q, want %q", lines[0], wantHeader)
+	}
+	// The row should still carry a trailing (empty) Error column rather than
+	// having it trimmed away: every row has exactly len(header) fields.
+	gotFields := strings.Count(lines[1], ",") + 1
+	wantFields := strings.Count(wantHeader, ",") + 1
+	if gotFields != wantFields {
+		t.Errorf("row %q has %d fields, want %d", lines[1], gotFields, wantFields)
+	}
+}
+
+func TestCSVEmitterErrorColumn(t *testing.T) {
+	var buf bytes.Buffer
+	e := newCSVEmitter(&buf, false, false, false)
+	if err := e.Header(); err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if err := e.Emit(Record{Path: "a", Type: 'f', Errors: []error{errors.New("boom")}}); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	e.Close()
+
+	if !strings.Contains(buf.String(), "boom") {
+		t.Errorf("expected error text in output, got %q", buf.String())
+	}
+}
+
+func TestJSONLEmitterRecord(t *testing.T) {
+	var buf bytes.Buffer
+	e := newJSONLEmitter(&buf)
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := e.Emit(Record{Path: "a/b", Type: 'f', Size: 7, MTime: mtime}); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if decoded["path"] != "a/b" {
+		t.Errorf("path = %v, want a/b", decoded["path"])
+	}
+	if decoded["type"] != "f" {
+		t.Errorf("type = %v, want f", decoded["type"])
+	}
+	if decoded["size"] != float64(7) {
+		t.Errorf("size = %v, want 7", decoded["size"])
+	}
+	if decoded["mtime"] != mtime.Format(time.RFC3339) {
+		t.Errorf("mtime = %v, want %v", decoded["mtime"], mtime.Format(time.RFC3339))
+	}
+	if _, present := decoded["error"]; present {
+		t.Errorf("error field should be omitted when there are no errors, got %v", decoded["error"])
+	}
+}
+
+func TestBinEmitterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	e := newBinEmitter(&buf)
+	record := Record{
+		Path:       "a/b",
+		Type:       'f',
+		Size:       123,
+		MTime:      time.Unix(1000, 0),
+		Nlink:      2,
+		Ino:        9,
+		ReparseTag: 1,
+		Hash:       "deadbeef",
+	}
+	if err := e.Emit(record); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data := buf.Bytes()
+	if len(data) < 4 {
+		t.Fatalf("output too short: %d bytes", len(data))
+	}
+	length := binary.BigEndian.Uint32(data[:4])
+	payload := data[4:]
+	if uint32(len(payload)) != length {
+		t.Fatalf("length prefix %d doesn't match payload length %d", length, len(payload))
+	}
+
+	readString := func() string {
+		n := binary.BigEndian.Uint32(payload[:4])
+		payload = payload[4:]
+		s := string(payload[:n])
+		payload = payload[n:]
+		return s
+	}
+	readUint64 := func() uint64 {
+		v := binary.BigEndian.Uint64(payload[:8])
+		payload = payload[8:]
+		return v
+	}
+
+	if path := readString(); path != record.Path {
+		t.Errorf("path = %q, want %q", path, record.Path)
+	}
+	if gotType := payload[0]; gotType != byte(record.Type) {
+		t.Errorf("type = %q, want %q", gotType, byte(record.Type))
+	}
+	payload = payload[1:]
+	if size := int64(readUint64()); size != record.Size {
+		t.Errorf("size = %d, want %d", size, record.Size)
+	}
+	if mtime := int64(readUint64()); mtime != record.MTime.UnixNano() {
+		t.Errorf("mtime = %d, want %d", mtime, record.MTime.UnixNano())
+	}
+}
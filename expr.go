@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Predicate decides whether a Record should be reported. Expressions built
+// with -expr compile to a tree of Predicates evaluated once per Record
+// inside the walker, before it's pushed onto finder.out.
+type Predicate interface {
+	Match(record *Record) bool
+}
+
+type predicateFunc func(record *Record) bool
+
+func (f predicateFunc) Match(record *Record) bool { return f(record) }
+
+type andPredicate []Predicate
+
+func (preds andPredicate) Match(record *Record) bool {
+	for _, p := range preds {
+		if !p.Match(record) {
+			return false
+		}
+	}
+	return true
+}
+
+type orPredicate []Predicate
+
+func (preds orPredicate) Match(record *Record) bool {
+	for _, p := range preds {
+		if p.Match(record) {
+			return true
+		}
+	}
+	return false
+}
+
+type notPredicate struct{ inner Predicate }
+
+func (p notPredicate) Match(record *Record) bool { return !p.inner.Match(record) }
+
+// exprCompiler parses a -expr argument into a Predicate. Grammar, loosest to
+// tightest binding: "-or", implicit/explicit "-and", "-not", then a
+// parenthesized sub-expression or a single test.
+type exprCompiler struct {
+	tokens    []string
+	pos       int
+	now       time.Time
+	needsStat bool
+}
+
+// compileExpr parses src into a Predicate, along with whether evaluating it
+// requires file metadata (so the caller can auto-enable finder.stat).
+func compileExpr(src string) (Predicate, bool, error) {
+	tokens := strings.Fields(src)
+	if len(tokens) == 0 {
+		return nil, false, fmt.Errorf("empty -expr")
+	}
+	c := &exprCompiler{tokens: tokens, now: time.Now()}
+	pred, err := c.parseOr()
+	if err != nil {
+		return nil, false, err
+	}
+	if tok := c.peek(); tok != "" {
+		return nil, false, fmt.Errorf("unexpected token %q in -expr", tok)
+	}
+	return pred, c.needsStat, nil
+}
+
+func (c *exprCompiler) peek() string {
+	if c.pos >= len(c.tokens) {
+		return ""
+	}
+	return c.tokens[c.pos]
+}
+
+func (c *exprCompiler) next() string {
+	tok := c.peek()
+	c.pos++
+	return tok
+}
+
+func (c *exprCompiler) parseOr() (Predicate, error) {
+	left, err := c.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	preds := []Predicate{left}
+	for c.peek() == "-or" {
+		c.next()
+		right, err := c.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, right)
+	}
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return orPredicate(preds), nil
+}
+
+func (c *exprCompiler) parseAnd() (Predicate, error) {
+	left, err := c.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	preds := []Predicate{left}
+	for {
+		switch c.peek() {
+		case "-and":
+			c.next()
+		case "", ")", "-or":
+			return andPredicate(preds).collapse(), nil
+		}
+		next, err := c.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, next)
+	}
+}
+
+func (preds andPredicate) collapse() Predicate {
+	if len(preds) == 1 {
+		return preds[0]
+	}
+	return preds
+}
+
+func (c *exprCompiler) parseNot() (Predicate, error) {
+	if c.peek() == "-not" {
+		c.next()
+		inner, err := c.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notPredicate{inner}, nil
+	}
+	return c.parsePrimary()
+}
+
+func (c *exprCompiler) parsePrimary() (Predicate, error) {
+	switch tok := c.peek(); tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end of -expr")
+	case "(":
+		c.next()
+		inner, err := c.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c.peek() != ")" {
+			return nil, fmt.Errorf("expected ) in -expr")
+		}
+		c.next()
+		return inner, nil
+	default:
+		return c.parseTest()
+	}
+}
+
+func (c *exprCompiler) parseTest() (Predicate, error) {
+	tok := c.next()
+	switch tok {
+	case "-name":
+		glob := c.next()
+		return predicateFunc(func(record *Record) bool {
+			ok, _ := filepath.Match(glob, filepath.Base(record.Path))
+			return ok
+		}), nil
+
+	case "-iname":
+		glob := strings.ToLower(c.next())
+		return predicateFunc(func(record *Record) bool {
+			ok, _ := filepath.Match(glob, strings.ToLower(filepath.Base(record.Path)))
+			return ok
+		}), nil
+
+	case "-path":
+		glob := c.next()
+		return predicateFunc(func(record *Record) bool {
+			ok, _ := filepath.Match(glob, record.Path)
+			return ok
+		}), nil
+
+	case "-type":
+		arg := c.next()
+		if len(arg) != 1 || !strings.ContainsRune("fdlpScD", rune(arg[0])) {
+			return nil, fmt.Errorf("invalid -type argument %q", arg)
+		}
+		want := rune(arg[0])
+		return predicateFunc(func(record *Record) bool { return record.Type == want }), nil
+
+	case "-size":
+		cmp, err := parseSizeTest(c.next())
+		if err != nil {
+			return nil, err
+		}
+		c.needsStat = true
+		return predicateFunc(func(record *Record) bool { return cmp(record.Size) }), nil
+
+	case "-newer":
+		ref := c.next()
+		info, err := os.Stat(ref)
+		if err != nil {
+			return nil, fmt.Errorf("-newer %s: %w", ref, err)
+		}
+		refTime := info.ModTime()
+		c.needsStat = true
+		return predicateFunc(func(record *Record) bool { return record.MTime.After(refTime) }), nil
+
+	case "-mtime":
+		cmp, err := parseNumericTest(c.next())
+		if err != nil {
+			return nil, err
+		}
+		now := c.now
+		c.needsStat = true
+		return predicateFunc(func(record *Record) bool {
+			return cmp(int64(now.Sub(record.MTime) / (24 * time.Hour)))
+		}), nil
+
+	case "-mmin":
+		cmp, err := parseNumericTest(c.next())
+		if err != nil {
+			return nil, err
+		}
+		now := c.now
+		c.needsStat = true
+		return predicateFunc(func(record *Record) bool {
+			return cmp(int64(now.Sub(record.MTime) / time.Minute))
+		}), nil
+
+	case "-empty":
+		c.needsStat = true
+		return predicateFunc(func(record *Record) bool {
+			return record.Type == 'f' && record.Size == 0
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unknown predicate %q", tok)
+	}
+}
+
+// parseNumericTest parses find(1)'s "+N"/"-N"/"N" numeric comparison syntax.
+func parseNumericTest(token string) (func(value int64) bool, error) {
+	if token == "" {
+		return nil, fmt.Errorf("missing numeric argument")
+	}
+	sign := token[0]
+	digits := token
+	if sign == '+' || sign == '-' {
+		digits = token[1:]
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid numeric argument %q: %w", token, err)
+	}
+	switch sign {
+	case '+':
+		return func(value int64) bool { return value > n }, nil
+	case '-':
+		return func(value int64) bool { return value < n }, nil
+	default:
+		return func(value int64) bool { return value == n }, nil
+	}
+}
+
+// parseSizeTest parses a -size argument ("+N[ckMG]"), returning a comparator
+// against a Record.Size in bytes. Unlike find's default 512-byte blocks,
+// a unit suffix is required here.
+func parseSizeTest(token string) (func(size int64) bool, error) {
+	if len(token) < 2 {
+		return nil, fmt.Errorf("invalid -size argument %q", token)
+	}
+	var unit int64
+	switch token[len(token)-1] {
+	case 'c':
+		unit = 1
+	case 'k':
+		unit = 1024
+	case 'M':
+		unit = 1024 * 1024
+	case 'G':
+		unit = 1024 * 1024 * 1024
+	default:
+		return nil, fmt.Errorf("invalid -size unit in %q (want c, k, M or G)", token)
+	}
+	cmp, err := parseNumericTest(token[:len(token)-1])
+	if err != nil {
+		return nil, err
+	}
+	// find rounds a file's size up to the next whole unit before comparing,
+	// so e.g. -size 1k matches a 1-byte file; round up here the same way
+	// rather than truncating, which would silently miss 1..unit-1 byte files.
+	return func(size int64) bool { return cmp((size + unit - 1) / unit) }, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNumericTest(t *testing.T) {
+	cases := []struct {
+		token string
+		value int64
+		want  bool
+	}{
+		{"5", 5, true},
+		{"5", 4, false},
+		{"+5", 6, true},
+		{"+5", 5, false},
+		{"-5", 4, true},
+		{"-5", 5, false},
+	}
+	for _, c := range cases {
+		cmp, err := parseNumericTest(c.token)
+		if err != nil {
+			t.Fatalf("parseNumericTest(%q): %v", c.token, err)
+		}
+		if got := cmp(c.value); got != c.want {
+			t.Errorf("parseNumericTest(%q)(%d) = %v, want %v", c.token, c.value, got, c.want)
+		}
+	}
+
+	if _, err := parseNumericTest(""); err == nil {
+		t.Error("parseNumericTest(\"\") should error")
+	}
+	if _, err := parseNumericTest("abc"); err == nil {
+		t.Error("parseNumericTest(\"abc\") should error")
+	}
+}
+
+func TestParseSizeTest(t *testing.T) {
+	cases := []struct {
+		token string
+		size  int64
+		want  bool
+	}{
+		{"+1k", 2048, true},
+		{"+1k", 512, false},
+		{"1M", 1024 * 1024, true},
+		// -size rounds a file's byte count up to the next whole unit before
+		// comparing, like find: a 1-byte file already counts as "1k", so
+		// -1G (strictly less than one full gigabyte-unit) only matches a
+		// genuinely empty file, not merely a small one.
+		{"-1G", 1024, false},
+		{"-1G", 0, true},
+		{"1c", 1, true},
+		{"1c", 0, false},
+	}
+	for _, c := range cases {
+		cmp, err := parseSizeTest(c.token)
+		if err != nil {
+			t.Fatalf("parseSizeTest(%q): %v", c.token, err)
+		}
+		if got := cmp(c.size); got != c.want {
+			t.Errorf("parseSizeTest(%q)(%d) = %v, want %v", c.token, c.size, got, c.want)
+		}
+	}
+
+	if _, err := parseSizeTest("5x"); err == nil {
+		t.Error("parseSizeTest(\"5x\") should error on unknown unit")
+	}
+	if _, err := parseSizeTest("k"); err == nil {
+		t.Error("parseSizeTest(\"k\") should error on missing number")
+	}
+}
+
+func TestCompileExprName(t *testing.T) {
+	pred, needsStat, err := compileExpr("-name *.go")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+	if needsStat {
+		t.Error("-name shouldn't require -stat")
+	}
+	if !pred.Match(&Record{Path: "dir/foo.go"}) {
+		t.Error("expected foo.go to match -name *.go")
+	}
+	if pred.Match(&Record{Path: "dir/foo.c"}) {
+		t.Error("expected foo.c not to match -name *.go")
+	}
+}
+
+func TestCompileExprAndOrNot(t *testing.T) {
+	pred, _, err := compileExpr("-type f -and -not -name *.go -or -type d")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+	cases := []struct {
+		record Record
+		want   bool
+	}{
+		{Record{Path: "a.c", Type: 'f'}, true},
+		{Record{Path: "a.go", Type: 'f'}, false},
+		{Record{Path: "dir", Type: 'd'}, true},
+	}
+	for _, c := range cases {
+		if got := pred.Match(&c.record); got != c.want {
+			t.Errorf("Match(%+v) = %v, want %v", c.record, got, c.want)
+		}
+	}
+}
+
+// TestCompileExprEmptyNeedsStat guards against the -empty predicate silently
+// matching every regular file when -stat isn't also enabled: record.Size is
+// only populated by the Unix walker when finder.stat is set, so -empty must ask
+// for it like -size/-mtime/-mmin/-newer do.
+func TestCompileExprEmptyNeedsStat(t *testing.T) {
+	_, needsStat, err := compileExpr("-empty")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+	if !needsStat {
+		t.Error("-empty must set needsStat so record.Size is actually populated")
+	}
+}
+
+func TestCompileExprEmptyMatch(t *testing.T) {
+	pred, _, err := compileExpr("-empty")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+	if !pred.Match(&Record{Type: 'f', Size: 0}) {
+		t.Error("expected zero-size regular file to match -empty")
+	}
+	if pred.Match(&Record{Type: 'f', Size: 1}) {
+		t.Error("expected non-empty regular file not to match -empty")
+	}
+	if pred.Match(&Record{Type: 'd', Size: 0}) {
+		t.Error("expected directory not to match -empty")
+	}
+}
+
+func TestCompileExprNewer(t *testing.T) {
+	_, needsStat, err := compileExpr("-newer expr_test.go")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+	if !needsStat {
+		t.Error("-newer should require -stat")
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"-type zz",
+		"-bogus",
+		"(-type f",
+		"-type f )",
+	}
+	for _, src := range cases {
+		if _, _, err := compileExpr(src); err == nil {
+			t.Errorf("compileExpr(%q) should have errored", src)
+		}
+	}
+}
+
+func TestCompileExprMtime(t *testing.T) {
+	pred, needsStat, err := compileExpr("-mtime -1")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+	if !needsStat {
+		t.Error("-mtime should require -stat")
+	}
+	if !pred.Match(&Record{Type: 'f', MTime: time.Now()}) {
+		t.Error("expected a file modified moments ago to match -mtime -1")
+	}
+	if pred.Match(&Record{Type: 'f', MTime: time.Now().Add(-48 * time.Hour)}) {
+		t.Error("expected a file modified two days ago not to match -mtime -1")
+	}
+}
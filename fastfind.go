@@ -2,14 +2,14 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -33,18 +33,109 @@ func fail(err error) {
 	os.Exit(ExitError)
 }
 
+// timeFormat is the timestamp layout used for every time-valued CSV column.
+const timeFormat = "2006-01-02 15:04:05.999999999 -0700"
+
 type Record struct {
-	Path   string
-	Type   rune
-	Size   int64
-	MTime  time.Time
-	Errors []error
+	Path       string
+	Type       rune
+	Size       int64
+	MTime      time.Time
+	BTime      time.Time
+	CTime      time.Time
+	Nlink      uint64
+	Ino        uint64
+	ReparseTag uint32
+	Hash       string
+	Errors     []error
 }
 
 type Finder struct {
 	group *errgroup.Group
 	out   chan<- Record
 	stat  bool
+	statx bool
+
+	// xdev/devices support: rootDev is the device id of the starting
+	// directory, fixed once before the walk begins.
+	xdev    bool
+	devices bool
+	rootDev uint64
+
+	deviceMu   sync.Mutex
+	deviceSeen map[uint64]deviceSummary
+
+	// predicate, when set, filters which records reach finder.out; maxDepth
+	// (-1 = unlimited) and minDepth gate recursion and reporting by depth
+	// below the starting directory.
+	predicate Predicate
+	maxDepth  int
+	minDepth  int
+
+	// hash, when set, names the digest -hash feeds regular files through.
+	// Hashing runs on its own bounded pool (hashGroup) since it's I/O-bound
+	// on file content rather than directory-bound; hashNextID/hashNextOut/
+	// hashPending reorder completed hashes back to the order they were
+	// submitted in, so concurrent hashing doesn't reorder a directory's
+	// hashed files relative to each other. Records that skip hashing
+	// (directories, symlinks, errors) are still sent immediately by the
+	// walker itself, so overall output order isn't guaranteed beyond that.
+	hash        string
+	hashGroup   *errgroup.Group
+	hashNextID  uint64
+	hashMu      sync.Mutex
+	hashNextOut uint64
+	hashPending map[uint64]hashPendingEntry
+}
+
+// send applies -mindepth/-maxdepth/-expr filtering to record and forwards it
+// to finder.out; errored records bypass -expr but not the depth limits. It returns false
+// if the context was canceled and the caller should stop walking.
+func (finder *Finder) send(ctx context.Context, record Record, depth int) bool {
+	if depth >= finder.minDepth && (finder.maxDepth < 0 || depth <= finder.maxDepth) &&
+		(len(record.Errors) != 0 || finder.predicate == nil || finder.predicate.Match(&record)) {
+		select {
+		case finder.out <- record:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// deviceSummary is one row of the -devices report: a distinct filesystem
+// encountered during the walk, identified by the path of the first
+// directory found on it.
+type deviceSummary struct {
+	ID     uint64
+	Root   string
+	FSType string
+}
+
+// recordDevice notes that path was found on filesystem dev, recording it as
+// that filesystem's root if it's the first time dev has been seen.
+func (finder *Finder) recordDevice(dev uint64, path, fstype string) {
+	finder.deviceMu.Lock()
+	defer finder.deviceMu.Unlock()
+	if finder.deviceSeen == nil {
+		finder.deviceSeen = make(map[uint64]deviceSummary)
+	}
+	if _, ok := finder.deviceSeen[dev]; !ok {
+		finder.deviceSeen[dev] = deviceSummary{ID: dev, Root: path, FSType: fstype}
+	}
+}
+
+// deviceSummaries returns the distinct filesystems recorded so far, ordered
+// by device id for stable output.
+func (finder *Finder) deviceSummaries() []deviceSummary {
+	finder.deviceMu.Lock()
+	defer finder.deviceMu.Unlock()
+	summaries := make([]deviceSummary, 0, len(finder.deviceSeen))
+	for _, s := range finder.deviceSeen {
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries
 }
 
 func type2rune(t os.FileMode) rune {
@@ -110,9 +201,46 @@ func main() {
 	}
 
 	flag.BoolVar(&finder.stat, "stat", false, "get file metadata")
+	flag.BoolVar(&finder.statx, "statx", false, "get extended metadata (birth/change time, inode, link count) where available")
+	flag.BoolVar(&finder.xdev, "xdev", false, "don't descend into directories on a different filesystem than DIR")
+	flag.BoolVar(&finder.devices, "devices", false, "emit a summary row per distinct filesystem visited")
+	var fuseMountpoint string
+	flag.StringVar(&fuseMountpoint, "fuse", "", "mount a read-only filesystem at MOUNTPOINT mirroring the walk, instead of writing output")
+	var exprSrc string
+	flag.StringVar(&exprSrc, "expr", "", "filter results with a find(1)-style predicate expression")
+	flag.IntVar(&finder.maxDepth, "maxdepth", -1, "descend at most this many levels below DIR")
+	flag.IntVar(&finder.minDepth, "mindepth", 0, "don't report results above this depth below DIR")
+	flag.StringVar(&finder.hash, "hash", "", "hash regular files while walking: blake3, sha256 or xxh3")
+	var format string
+	flag.StringVar(&format, "format", "csv", "output format: csv, jsonl, or bin (a fastfind-private length-delimited binary framing, not protobuf/Parquet)")
 	flag.Usage = usage
 	flag.Parse()
 
+	if finder.statx {
+		finder.stat = true
+	}
+
+	if finder.hash != "" {
+		switch finder.hash {
+		case "blake3", "sha256", "xxh3":
+		default:
+			fail(fmt.Errorf("invalid -hash algorithm %q (want blake3, sha256 or xxh3)", finder.hash))
+		}
+		finder.hashGroup = &errgroup.Group{}
+		finder.hashGroup.SetLimit(hashLimit)
+	}
+
+	if exprSrc != "" {
+		predicate, needsStat, err := compileExpr(exprSrc)
+		if err != nil {
+			fail(err)
+		}
+		finder.predicate = predicate
+		if needsStat {
+			finder.stat = true
+		}
+	}
+
 	var path string
 	switch len(flag.Args()) {
 	case 0:
@@ -129,80 +257,72 @@ func main() {
 		fail(err)
 	}
 
+	if finder.xdev || finder.devices {
+		dev, err := deviceID(root)
+		if err != nil {
+			fail(err)
+		}
+		finder.rootDev = dev
+		if finder.devices {
+			fstype, _ := filesystemType(root)
+			finder.recordDevice(dev, path, fstype)
+		}
+	}
+
 	g.Go(func() error {
-		finder.walk(ctx, path, root)
+		finder.walk(ctx, path, root, 0)
 		return nil
 	})
 
 	go func() {
 		g.Wait()
+		if finder.hashGroup != nil {
+			finder.hashGroup.Wait()
+		}
 		close(records)
 	}()
 
-	writer := csv.NewWriter(os.Stdout)
-	defer writer.Flush()
-
-	row := make([]string, 0, 16)
-
-	row = append(row, "Path", "Type")
-	if finder.stat {
-		row = append(row, "Size", "MTime")
+	if fuseMountpoint != "" {
+		if err := serveFUSE(ctx, records, fuseMountpoint); err != nil {
+			fail(err)
+		}
+		if err := g.Wait(); err != nil {
+			fail(err)
+		}
+		return
 	}
-	row = append(row, "Error")
 
-	writer.Write(row)
+	emitter, err := newEmitter(format, os.Stdout, &finder)
 	if err != nil {
 		fail(err)
 	}
+	if err := emitter.Header(); err != nil {
+		fail(err)
+	}
 
 	ok := true
 
-	for {
-		record, ok := <-records
-		if !ok {
-			break
-		}
-
-		row = row[:0]
-
-		row = append(row, record.Path)
-		row = append(row, string(record.Type))
-
-		if finder.stat {
-			if len(record.Errors) == 0 && record.Type == 'f' {
-				row = append(row, strconv.FormatInt(record.Size, 10))
-			} else {
-				row = append(row, "")
-			}
-			if !record.MTime.IsZero() {
-				row = append(row, record.MTime.Format("2006-01-02 15:04:05.999999999 -0700"))
-			} else {
-				row = append(row, "")
-			}
-		}
-
+	for record := range records {
 		if len(record.Errors) != 0 {
-			row = append(row, joinErrors(record.Errors))
 			ok = false
 		}
-
-		for len(row) > 1 && row[len(row)-1] == "" {
-			row = row[:len(row)-1]
-		}
-
-		err := writer.Write(row)
-		if err != nil {
+		if err := emitter.Emit(record); err != nil {
 			fail(err)
 		}
 	}
 
-	writer.Flush()
-	if err := writer.Error(); err != nil {
+	err = g.Wait()
+	if err != nil {
 		fail(err)
 	}
 
-	err = g.Wait()
-	if err != nil {
+	if finder.devices {
+		if err := emitter.Devices(finder.deviceSummaries()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if err := emitter.Close(); err != nil {
 		fail(err)
 	}
 
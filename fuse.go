@@ -0,0 +1,162 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// trieNode is one path component observed during the walk. Children are
+// keyed by name and materialize into fs.Inodes lazily, the first time the
+// kernel looks them up, so a huge scan doesn't have to build the whole
+// FUSE inode tree up front.
+type trieNode struct {
+	fs.Inode
+
+	mu       sync.Mutex
+	record   Record
+	children map[string]*trieNode
+}
+
+var (
+	_ fs.NodeLookuper  = (*trieNode)(nil)
+	_ fs.NodeReaddirer = (*trieNode)(nil)
+	_ fs.NodeGetattrer = (*trieNode)(nil)
+)
+
+func (n *trieNode) child(name string) *trieNode {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.children == nil {
+		n.children = make(map[string]*trieNode)
+	}
+	child, ok := n.children[name]
+	if !ok {
+		child = &trieNode{}
+		n.children[name] = child
+	}
+	return child
+}
+
+// insert places record into the trie, creating intermediate directory nodes
+// along its path as needed.
+func (root *trieNode) insert(record Record) {
+	clean := filepath.ToSlash(filepath.Clean(record.Path))
+	if clean == "." {
+		clean = ""
+	} else {
+		clean = strings.TrimPrefix(clean, "./")
+	}
+	node := root
+	if clean != "" {
+		for _, part := range strings.Split(clean, "/") {
+			node = node.child(part)
+		}
+	}
+	node.mu.Lock()
+	node.record = record
+	node.mu.Unlock()
+}
+
+func modeFor(record Record) uint32 {
+	switch record.Type {
+	case 'd':
+		return syscall.S_IFDIR
+	case 'l':
+		return syscall.S_IFLNK
+	case 'p':
+		return syscall.S_IFIFO
+	case 'S':
+		return syscall.S_IFSOCK
+	case 'c':
+		return syscall.S_IFCHR
+	case 'D':
+		return syscall.S_IFBLK
+	default:
+		return syscall.S_IFREG
+	}
+}
+
+func (n *trieNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	n.mu.Lock()
+	child, ok := n.children[name]
+	n.mu.Unlock()
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	child.mu.Lock()
+	stable := fs.StableAttr{Mode: modeFor(child.record)}
+	fillAttr(&out.Attr, child.record)
+	child.mu.Unlock()
+	return n.NewInode(ctx, child, stable), 0
+}
+
+func (n *trieNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	entries := make([]fuse.DirEntry, 0, len(n.children))
+	for name, child := range n.children {
+		child.mu.Lock()
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: modeFor(child.record)})
+		child.mu.Unlock()
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *trieNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	fillAttr(&out.Attr, n.record)
+	return 0
+}
+
+// fillAttr fills a placeholder fuse.Attr from the collected Record: zero
+// content, but the size/mtime/type the walk observed.
+func fillAttr(attr *fuse.Attr, record Record) {
+	attr.Mode = modeFor(record) | 0444
+	if record.Type == 'd' {
+		attr.Mode |= 0111
+	}
+	attr.Size = uint64(record.Size)
+	if !record.MTime.IsZero() {
+		attr.SetTimes(nil, &record.MTime, nil)
+	}
+}
+
+// serveFUSE drains records into an in-memory trie and mounts it read-only at
+// mountpoint, blocking until the filesystem is unmounted (by the kernel, by
+// ctx being canceled, or by `umount`).
+func serveFUSE(ctx context.Context, records <-chan Record, mountpoint string) error {
+	root := &trieNode{record: Record{Type: 'd'}}
+
+	server, err := fs.Mount(mountpoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:   "fastfind",
+			Name:     "fastfind",
+			ReadOnly: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("fuse mount failed: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Unmount()
+	}()
+
+	for record := range records {
+		root.insert(record)
+	}
+
+	server.Wait()
+	return nil
+}
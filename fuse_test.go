@@ -0,0 +1,97 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTrieNodeInsertAndChild(t *testing.T) {
+	root := &trieNode{record: Record{Type: 'd'}}
+	root.insert(Record{Path: ".", Type: 'd'})
+	root.insert(Record{Path: "a", Type: 'd'})
+	root.insert(Record{Path: "a/b.txt", Type: 'f', Size: 42})
+	root.insert(Record{Path: "./.hidden", Type: 'f'})
+
+	a, ok := root.children["a"]
+	if !ok {
+		t.Fatal("expected child \"a\" under root")
+	}
+	b, ok := a.children["b.txt"]
+	if !ok {
+		t.Fatal("expected child \"b.txt\" under a")
+	}
+	if b.record.Size != 42 {
+		t.Errorf("b.txt size = %d, want 42", b.record.Size)
+	}
+
+	// Regression coverage for the leading-dot cutset bug: ".hidden" must
+	// survive as its own top-level child, not be mangled into "hidden".
+	if _, ok := root.children[".hidden"]; !ok {
+		t.Error("expected leading-dot path component to survive intact as \".hidden\"")
+	}
+}
+
+func TestTrieNodeChildIsStable(t *testing.T) {
+	root := &trieNode{}
+	first := root.child("x")
+	second := root.child("x")
+	if first != second {
+		t.Error("child(\"x\") should return the same node on repeated calls")
+	}
+}
+
+// TestServeFUSEMount exercises insert/Lookup/Readdir end to end through an
+// actual FUSE mount, the integration surface -fuse was built around. It
+// skips, rather than fails, when the sandbox can't mount FUSE (no
+// /dev/fuse, insufficient privilege), since that's an environment limit
+// rather than a bug in this package.
+func TestServeFUSEMount(t *testing.T) {
+	mountpoint := t.TempDir()
+
+	records := make(chan Record, 1)
+	records <- Record{Path: "a.txt", Type: 'f', Size: 5, MTime: time.Now()}
+	close(records)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- serveFUSE(ctx, records, mountpoint) }()
+
+	select {
+	case err := <-done:
+		t.Skipf("fuse mount unavailable in this sandbox: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	var entries []os.DirEntry
+	var err error
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, err = os.ReadDir(mountpoint)
+		if err == nil && len(entries) > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if err != nil || len(entries) == 0 {
+		t.Skipf("could not read back the FUSE mount in this sandbox: readdir err %v, entries %v", err, entries)
+	}
+	if entries[0].Name() != "a.txt" {
+		t.Fatalf("entry name = %q, want a.txt", entries[0].Name())
+	}
+	info, err := entries[0].Info()
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Size() != 5 {
+		t.Errorf("size = %d, want 5", info.Size())
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// serveFUSE isn't available on Windows: go-fuse only speaks the FUSE
+// protocol used by Linux and macOS kernels.
+func serveFUSE(ctx context.Context, records <-chan Record, mountpoint string) error {
+	return errors.New("-fuse is not supported on Windows")
+}
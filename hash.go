@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zeebo/xxh3"
+	"lukechampine.com/blake3"
+)
+
+// hashLimit bounds concurrent file hashing independently of finder.group's
+// directory-walking limit: hashing is I/O-bound on the file's own contents
+// rather than directory-bound, so it gets its own errgroup and cap.
+const hashLimit = 64
+
+// hashBufferPool hands hashFile a reusable 256 KiB copy buffer instead of
+// allocating one per file, since hashLimit workers can be streaming files
+// concurrently.
+var hashBufferPool = sync.Pool{
+	New: func() interface{} { return make([]byte, 256*1024) },
+}
+
+// hashPendingEntry is a hashed Record waiting in finder.hashPending for its
+// turn to be emitted, so hashing concurrency doesn't reorder sibling files.
+type hashPendingEntry struct {
+	record Record
+	depth  int
+}
+
+// submitHash assigns f's record the next monotonic hash-ordering id and
+// hands the already-open file off to the hash pool, returning false if the
+// context was canceled before the job could be queued.
+func (finder *Finder) submitHash(ctx context.Context, f *os.File, record Record, depth int) bool {
+	select {
+	case <-ctx.Done():
+		f.Close()
+		return false
+	default:
+	}
+
+	id := atomic.AddUint64(&finder.hashNextID, 1) - 1
+	finder.hashGroup.Go(func() error {
+		finder.hashFile(ctx, f, record, id, depth)
+		return nil
+	})
+	return true
+}
+
+// hashFile streams f through the configured algorithm and hands the
+// completed record to completeHash for in-order delivery.
+func (finder *Finder) hashFile(ctx context.Context, f *os.File, record Record, id uint64, depth int) {
+	defer f.Close()
+
+	hasher, err := newHasher(finder.hash)
+	if err != nil {
+		record.Errors = append(record.Errors, err)
+	} else {
+		buf := hashBufferPool.Get().([]byte)
+		_, err := io.CopyBuffer(hasher, f, buf)
+		hashBufferPool.Put(buf)
+		if err != nil {
+			record.Errors = append(record.Errors, fmt.Errorf("hash %s: %w", record.Path, err))
+		} else {
+			record.Hash = hex.EncodeToString(hasher.Sum(nil))
+		}
+	}
+
+	finder.completeHash(ctx, record, id, depth)
+}
+
+// submitEmptyHash handles a file already known (via a prior stat) to be
+// zero-length: the stream digest of no input is a fixed value, so it's
+// computed directly rather than opening the file and submitting it to
+// hashGroup. It still goes through the same id/completeHash bookkeeping as
+// hashFile so it doesn't reorder relative to its hashed siblings.
+func (finder *Finder) submitEmptyHash(ctx context.Context, record Record, depth int) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	default:
+	}
+
+	id := atomic.AddUint64(&finder.hashNextID, 1) - 1
+
+	hasher, err := newHasher(finder.hash)
+	if err != nil {
+		record.Errors = append(record.Errors, err)
+	} else {
+		record.Hash = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	finder.completeHash(ctx, record, id, depth)
+	return true
+}
+
+// completeHash buffers a finished hash job until every lower id has been
+// delivered, then flushes the resulting run of in-order records to
+// finder.out via send (which applies -mindepth/-expr as usual).
+func (finder *Finder) completeHash(ctx context.Context, record Record, id uint64, depth int) {
+	// hashMu is held through the sends so a later run can't overtake an
+	// earlier one that another goroutine is still delivering.
+	finder.hashMu.Lock()
+	defer finder.hashMu.Unlock()
+	if finder.hashPending == nil {
+		finder.hashPending = make(map[uint64]hashPendingEntry)
+	}
+	finder.hashPending[id] = hashPendingEntry{record: record, depth: depth}
+
+	var ready []hashPendingEntry
+	for {
+		entry, ok := finder.hashPending[finder.hashNextOut]
+		if !ok {
+			break
+		}
+		ready = append(ready, entry)
+		delete(finder.hashPending, finder.hashNextOut)
+		finder.hashNextOut++
+	}
+
+	for _, entry := range ready {
+		if !finder.send(ctx, entry.record, entry.depth) {
+			return
+		}
+	}
+}
+
+func newHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "blake3":
+		return blake3.New(32, nil), nil
+	case "xxh3":
+		return xxh3.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algo)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// statxMask requests only the fields fastfind actually surfaces, so a single
+// statx(2) call stays cheap even over network filesystems (NFSv4, CIFS) that
+// implement it.
+const statxMask = unix.STATX_MTIME | unix.STATX_CTIME | unix.STATX_BTIME | unix.STATX_INO | unix.STATX_NLINK | unix.STATX_SIZE
+
+// populateStatx fills record via statx(2). It reports false when statx isn't
+// supported (ENOSYS on old kernels) so the caller can fall back to fstat/fstatat.
+// A dir (name == "") is queried with AT_EMPTY_PATH directly on its open fd,
+// avoiding a second syscall to resolve a path.
+func populateStatx(record *Record, dirfd int, name string, flags int) bool {
+	atFlags := flags
+	if name == "" {
+		atFlags |= unix.AT_EMPTY_PATH
+	}
+
+	var stat unix.Statx_t
+	err := unix.Statx(dirfd, name, atFlags, statxMask, &stat)
+	if err == unix.ENOSYS {
+		return false
+	}
+	if err != nil {
+		record.Errors = append(record.Errors, fmt.Errorf("statx failed: %w", err))
+		return true
+	}
+
+	if stat.Mask&unix.STATX_SIZE != 0 {
+		record.Size = int64(stat.Size)
+	}
+	if stat.Mask&unix.STATX_MTIME != 0 {
+		record.MTime = timeFromStatx(stat.Mtime)
+	}
+	if stat.Mask&unix.STATX_CTIME != 0 {
+		record.CTime = timeFromStatx(stat.Ctime)
+	}
+	if stat.Mask&unix.STATX_BTIME != 0 {
+		record.BTime = timeFromStatx(stat.Btime)
+	}
+	if stat.Mask&unix.STATX_NLINK != 0 {
+		record.Nlink = uint64(stat.Nlink)
+	}
+	if stat.Mask&unix.STATX_INO != 0 {
+		record.Ino = stat.Ino
+	}
+	return true
+}
+
+func timeFromStatx(ts unix.StatxTimestamp) time.Time {
+	return time.Unix(ts.Sec, int64(ts.Nsec))
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+
+package main
+
+// populateStatx is unavailable outside Linux; populateStat always falls back
+// to plain fstat/fstatat on these platforms.
+func populateStatx(record *Record, dirfd int, name string, flags int) bool {
+	return false
+}
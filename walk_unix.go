@@ -17,7 +17,7 @@ func openDirHandle(path string) (dirHandle, error) {
 	return unix.Open(path, unix.O_DIRECTORY, 0)
 }
 
-func (finder *Finder) walk(ctx context.Context, path string, dir dirHandle) {
+func (finder *Finder) walk(ctx context.Context, path string, dir dirHandle, depth int) {
 	f := os.NewFile(uintptr(dir), path)
 	defer f.Close()
 
@@ -27,28 +27,22 @@ func (finder *Finder) walk(ctx context.Context, path string, dir dirHandle) {
 	}
 
 	if finder.stat {
-		var stat unix.Stat_t
-		err := unix.Fstat(int(dir), &stat)
-		if err == nil {
-			record.MTime = timeFromSpec(stat.Mtim)
-		} else {
-			record.Errors = append(record.Errors, fmt.Errorf("Fstat failed: %w", err))
-		}
+		finder.populateStat(&record, int(dir), "", 0)
 	}
 
 	entries, err := f.ReadDir(-1)
 	if err != nil {
 		record.Errors = append(record.Errors, fmt.Errorf("ReadDir failed: %w", err))
 	}
-	select {
-	case finder.out <- record:
-	case <-ctx.Done():
+	if !finder.send(ctx, record, depth) {
 		return
 	}
 	if err != nil {
 		return
 	}
 
+	atMaxDepth := finder.maxDepth >= 0 && depth+1 > finder.maxDepth
+
 	for _, entry := range entries {
 		name := entry.Name()
 		record := Record{
@@ -65,30 +59,51 @@ func (finder *Finder) walk(ctx context.Context, path string, dir dirHandle) {
 		}
 
 		if finder.stat && record.Type != 'd' {
-			var stat unix.Stat_t
-			err = unix.Fstatat(int(dir), name, &stat, unix.AT_SYMLINK_NOFOLLOW)
-			if err != nil {
-				record.Errors = append(record.Errors, fmt.Errorf("fstatat failed: %w", err))
+			finder.populateStat(&record, int(dir), name, unix.AT_SYMLINK_NOFOLLOW)
+		}
+
+		crossesDevice := false
+		if record.Type == 'd' && len(record.Errors) == 0 && (finder.xdev || finder.devices) {
+			dev, derr := deviceID(subdir)
+			if derr != nil {
+				record.Errors = append(record.Errors, fmt.Errorf("device check failed: %w", derr))
+				unix.Close(subdir)
 			} else {
-				record.Size = stat.Size
-				record.MTime = timeFromSpec(stat.Mtim)
+				if finder.devices {
+					fstype, _ := filesystemType(subdir)
+					finder.recordDevice(dev, record.Path, fstype)
+				}
+				crossesDevice = finder.xdev && dev != finder.rootDev
 			}
 		}
 
-		if record.Type == 'd' && len(record.Errors) == 0 {
+		if record.Type == 'd' && len(record.Errors) == 0 && !crossesDevice && !atMaxDepth {
 			childPath := record.Path
 			handle := subdir
+			childDepth := depth + 1
 			went := finder.group.TryGo(func() error {
-				finder.walk(ctx, childPath, handle)
+				finder.walk(ctx, childPath, handle, childDepth)
 				return nil
 			})
 			if !went {
-				finder.walk(ctx, childPath, handle)
+				finder.walk(ctx, childPath, handle, childDepth)
 			}
 		} else {
-			select {
-			case finder.out <- record:
-			case <-ctx.Done():
+			if record.Type == 'd' && len(record.Errors) == 0 && (crossesDevice || atMaxDepth) {
+				unix.Close(subdir)
+			}
+			if finder.hash != "" && record.Type == 'f' && len(record.Errors) == 0 {
+				if finder.stat && record.Size == 0 {
+					if finder.submitEmptyHash(ctx, record, depth+1) {
+						continue
+					}
+				} else if hf, herr := openRelativeFile(dir, name); herr != nil {
+					record.Errors = append(record.Errors, fmt.Errorf("open for hashing failed: %w", herr))
+				} else if finder.submitHash(ctx, hf, record, depth+1) {
+					continue
+				}
+			}
+			if !finder.send(ctx, record, depth+1) {
 				return
 			}
 		}
@@ -98,3 +113,56 @@ func (finder *Finder) walk(ctx context.Context, path string, dir dirHandle) {
 func timeFromSpec(ts unix.Timespec) time.Time {
 	return time.Unix(int64(ts.Sec), int64(ts.Nsec))
 }
+
+// populateStat fills in record's stat-derived fields for the file named name
+// inside dirfd (or dirfd itself, when name is ""). When finder.statx is set
+// it prefers a single statx(2) call carrying mtime/ctime/btime/nlink/ino,
+// falling back to a plain fstat/fstatat when statx isn't available.
+func (finder *Finder) populateStat(record *Record, dirfd int, name string, flags int) {
+	if finder.statx && populateStatx(record, dirfd, name, flags) {
+		return
+	}
+
+	var stat unix.Stat_t
+	var err error
+	if name == "" {
+		err = unix.Fstat(dirfd, &stat)
+	} else {
+		err = unix.Fstatat(dirfd, name, &stat, flags)
+	}
+	if err != nil {
+		record.Errors = append(record.Errors, fmt.Errorf("stat failed: %w", err))
+		return
+	}
+	record.Size = stat.Size
+	record.MTime = timeFromSpec(stat.Mtim)
+	record.Nlink = uint64(stat.Nlink)
+	record.Ino = stat.Ino
+}
+
+// deviceID returns the device id of the already-open directory dir, for
+// -xdev/-devices filesystem-boundary tracking.
+func deviceID(dir dirHandle) (uint64, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(dir), &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Dev), nil
+}
+
+// openRelativeFile opens name relative to the already-open directory dir,
+// for handing off to the hash pool without re-resolving the path from root.
+func openRelativeFile(dir dirHandle, name string) (*os.File, error) {
+	fd, err := unix.Openat(int(dir), name, unix.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// filesystemType would report a human-readable filesystem type for dir, but
+// there's no cheap portable way to decode a statfs magic number into a name
+// on Unix, so -devices leaves this column blank here.
+func filesystemType(dir dirHandle) (string, error) {
+	return "", nil
+}
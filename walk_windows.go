@@ -4,12 +4,14 @@ package main
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode/utf16"
 	"unsafe"
@@ -20,18 +22,29 @@ import (
 type dirHandle = windows.Handle
 
 const (
-	dirQueryInitialBuffer  = 64 * 1024
-	dirQueryMaxBuffer      = 1 << 30
-	fileFullDirectoryClass = 2 // FileFullDirectoryInformation
-	fileInfoHeaderSize     = int(unsafe.Offsetof(fileFullDirInformation{}.FileName))
+	dirQueryInitialBuffer    = 64 * 1024
+	dirQueryMaxBuffer        = 1 << 30
+	fileFullDirectoryClass   = 2  // FileFullDirectoryInformation
+	fileIdExtdDirectoryClass = 60 // FileIdExtdDirectoryInformation
+	fileInfoHeaderSize       = int(unsafe.Offsetof(fileFullDirInformation{}.FileName))
+	fileIdExtdInfoHeaderSize = int(unsafe.Offsetof(fileIdExtdDirInformation{}.FileName))
 )
 
 var (
 	modntdll                 = windows.NewLazySystemDLL("ntdll.dll")
 	procNtQueryDirectoryFile = modntdll.NewProc("NtQueryDirectoryFile")
 	errDirBufferTooSmall     = errors.New("fastfind: directory entry exceeds query buffer")
+	errDirClassUnsupported   = errors.New("fastfind: directory info class unsupported")
 )
 
+// activeDirClass is the NtQueryDirectoryFile information class fastfind
+// currently queries with. It starts at FileIdExtdDirectoryInformation for
+// the file id and reparse tag it carries, and is downgraded once to
+// FileFullDirectoryInformation (accessed atomically, shared across the
+// directory-walking goroutines) the first time a share responds with
+// STATUS_INVALID_INFO_CLASS, e.g. some SMB1 servers.
+var activeDirClass int32 = fileIdExtdDirectoryClass
+
 type fileFullDirInformation struct {
 	NextEntryOffset uint32
 	FileIndex       uint32
@@ -47,11 +60,35 @@ type fileFullDirInformation struct {
 	FileName        [1]uint16
 }
 
+// fileIdExtdDirInformation mirrors FILE_ID_EXTD_DIR_INFORMATION, adding a
+// 128-bit file id and the reparse tag (when the entry is a reparse point)
+// over what FileFullDirectoryInformation carries.
+type fileIdExtdDirInformation struct {
+	NextEntryOffset uint32
+	FileIndex       uint32
+	CreationTime    int64
+	LastAccessTime  int64
+	LastWriteTime   int64
+	ChangeTime      int64
+	EndOfFile       int64
+	AllocationSize  int64
+	FileAttributes  uint32
+	FileNameLength  uint32
+	EaSize          uint32
+	ReparsePointTag uint32
+	FileId          [16]byte
+	FileName        [1]uint16
+}
+
 type dirEntry struct {
-	name  string
-	mode  os.FileMode
-	size  int64
-	mtime time.Time
+	name       string
+	mode       os.FileMode
+	size       int64
+	mtime      time.Time
+	btime      time.Time
+	ctime      time.Time
+	ino        uint64
+	reparseTag uint32
 }
 
 func openDirHandle(path string) (dirHandle, error) {
@@ -76,29 +113,28 @@ func openDirHandle(path string) (dirHandle, error) {
 	return handle, nil
 }
 
-func (finder *Finder) walk(ctx context.Context, path string, dir dirHandle) {
+func (finder *Finder) walk(ctx context.Context, path string, dir dirHandle, depth int) {
 	var entry dirEntry
 	var info windows.ByHandleFileInformation
 	err := windows.GetFileInformationByHandle(dir, &info)
 	if err == nil {
 		entry.mtime = filetimeToTime(info.LastWriteTime)
+		entry.btime = filetimeToTime(info.CreationTime)
 	} else {
 		record := Record{
 			Path:   path,
 			Type:   'd',
 			Errors: []error{fmt.Errorf("GetFileInformationByHandle failed: %w", err)},
 		}
-		select {
-		case finder.out <- record:
-		case <-ctx.Done():
+		if !finder.send(ctx, record, depth) {
 			return
 		}
 	}
 
-	finder._walk(ctx, path, dir, entry)
+	finder._walk(ctx, path, dir, entry, depth)
 }
 
-func (finder *Finder) _walk(ctx context.Context, path string, dir dirHandle, entry dirEntry) {
+func (finder *Finder) _walk(ctx context.Context, path string, dir dirHandle, entry dirEntry, depth int) {
 	defer windows.CloseHandle(dir)
 
 	entries, err := enumerateDirectory(dir)
@@ -106,24 +142,30 @@ func (finder *Finder) _walk(ctx context.Context, path string, dir dirHandle, ent
 		Path:  path,
 		Type:  'd',
 		MTime: entry.mtime,
+		BTime: entry.btime,
+		CTime: entry.ctime,
 	}
 	if err != nil {
 		record.Errors = append(record.Errors, err)
 	}
-	select {
-	case finder.out <- record:
-	case <-ctx.Done():
+	if !finder.send(ctx, record, depth) {
 		return
 	}
 	if err != nil {
 		return
 	}
 
+	atMaxDepth := finder.maxDepth >= 0 && depth+1 > finder.maxDepth
+
 	for _, entry := range entries {
 		record := Record{
-			Path:  childPath(path, entry.name),
-			Type:  type2rune(entry.mode),
-			MTime: entry.mtime,
+			Path:       childPath(path, entry.name),
+			Type:       type2rune(entry.mode),
+			MTime:      entry.mtime,
+			BTime:      entry.btime,
+			CTime:      entry.ctime,
+			Ino:        entry.ino,
+			ReparseTag: entry.reparseTag,
 		}
 
 		var subdir dirHandle
@@ -138,40 +180,97 @@ func (finder *Finder) _walk(ctx context.Context, path string, dir dirHandle, ent
 			record.Size = entry.size
 		}
 
-		if record.Type == 'd' && len(record.Errors) == 0 {
+		crossesDevice := false
+		if record.Type == 'd' && len(record.Errors) == 0 && (finder.xdev || finder.devices) {
+			dev, derr := deviceID(subdir)
+			if derr != nil {
+				record.Errors = append(record.Errors, fmt.Errorf("device check failed: %w", derr))
+				windows.CloseHandle(subdir)
+			} else {
+				if finder.devices {
+					fstype, _ := filesystemType(subdir)
+					finder.recordDevice(dev, record.Path, fstype)
+				}
+				crossesDevice = finder.xdev && dev != finder.rootDev
+			}
+		}
+
+		if record.Type == 'd' && len(record.Errors) == 0 && !crossesDevice && !atMaxDepth {
 			childPath := record.Path
 			handle := subdir
+			childDepth := depth + 1
 			went := finder.group.TryGo(func() error {
-				finder._walk(ctx, childPath, handle, entry)
+				finder._walk(ctx, childPath, handle, entry, childDepth)
 				return nil
 			})
 			if !went {
-				finder._walk(ctx, childPath, handle, entry)
+				finder._walk(ctx, childPath, handle, entry, childDepth)
 			}
 		} else {
-			select {
-			case finder.out <- record:
-			case <-ctx.Done():
+			if record.Type == 'd' && len(record.Errors) == 0 && (crossesDevice || atMaxDepth) {
+				windows.CloseHandle(subdir)
+			}
+			if finder.hash != "" && record.Type == 'f' && len(record.Errors) == 0 {
+				if record.Size == 0 {
+					if finder.submitEmptyHash(ctx, record, depth+1) {
+						continue
+					}
+				} else if hf, herr := openRelativeFile(dir, entry.name); herr != nil {
+					record.Errors = append(record.Errors, fmt.Errorf("open for hashing failed: %w", herr))
+				} else if finder.submitHash(ctx, hf, record, depth+1) {
+					continue
+				}
+			}
+			if !finder.send(ctx, record, depth+1) {
 				return
 			}
 		}
 	}
 }
 
+// headerSizeForClass returns the fixed-field size preceding FileName for the
+// given NtQueryDirectoryFile information class.
+func headerSizeForClass(class int32) int {
+	if class == fileIdExtdDirectoryClass {
+		return fileIdExtdInfoHeaderSize
+	}
+	return fileInfoHeaderSize
+}
+
 func enumerateDirectory(handle dirHandle) ([]dirEntry, error) {
+	class := atomic.LoadInt32(&activeDirClass)
+	headerSize := headerSizeForClass(class)
 	bufSize := dirQueryInitialBuffer
-	if bufSize < fileInfoHeaderSize+2 {
-		bufSize = fileInfoHeaderSize + 2
+	if bufSize < headerSize+2 {
+		bufSize = headerSize + 2
 	}
 	buffer := make([]byte, bufSize)
 	restart := true
 	entries := make([]dirEntry, 0, 128)
 
 	for {
-		n, status, err := ntQueryDirectory(handle, buffer, restart)
+		n, status, err := ntQueryDirectory(handle, buffer, restart, class)
 		if err == io.EOF {
 			break
 		}
+		if errors.Is(err, errDirClassUnsupported) {
+			if class == fileFullDirectoryClass {
+				return nil, fmt.Errorf("NtQueryDirectoryFile failed: %w", err)
+			}
+			// Some shares (e.g. SMB1) reject FileIdExtdDirectoryInformation;
+			// downgrade once, for every directory, and restart this one.
+			class = fileFullDirectoryClass
+			atomic.StoreInt32(&activeDirClass, class)
+			headerSize = headerSizeForClass(class)
+			bufSize = dirQueryInitialBuffer
+			if bufSize < headerSize+2 {
+				bufSize = headerSize + 2
+			}
+			buffer = make([]byte, bufSize)
+			restart = true
+			entries = entries[:0]
+			continue
+		}
 		if errors.Is(err, errDirBufferTooSmall) {
 			if bufSize >= dirQueryMaxBuffer {
 				return nil, fmt.Errorf("NtQueryDirectoryFile: entry larger than %d bytes", bufSize)
@@ -191,29 +290,28 @@ func enumerateDirectory(handle dirHandle) ([]dirEntry, error) {
 		chunk := buffer[:n]
 		offset := 0
 		for offset < len(chunk) {
-			if len(chunk[offset:]) < fileInfoHeaderSize {
+			if len(chunk[offset:]) < headerSize {
 				return nil, fmt.Errorf("NtQueryDirectoryFile returned truncated data")
 			}
-			info := (*fileFullDirInformation)(unsafe.Pointer(&chunk[offset]))
-			nameBytes := int(info.FileNameLength)
-			if nameBytes < 0 || nameBytes > len(chunk[offset:])-fileInfoHeaderSize {
-				return nil, fmt.Errorf("NtQueryDirectoryFile returned truncated data")
+			var entry dirEntry
+			var skip bool
+			var nextEntryOffset uint32
+			var parseErr error
+			if class == fileIdExtdDirectoryClass {
+				entry, skip, nextEntryOffset, parseErr = parseIdExtdDirEntry(chunk[offset:])
+			} else {
+				entry, skip, nextEntryOffset, parseErr = parseFullDirEntry(chunk[offset:])
 			}
-			nameLen := nameBytes / 2
-			nameSlice := unsafe.Slice(&info.FileName[0], nameLen)
-			name := string(utf16.Decode(nameSlice))
-			if name != "." && name != ".." {
-				entries = append(entries, dirEntry{
-					name:  name,
-					mode:  attributesToMode(info.FileAttributes),
-					size:  info.EndOfFile,
-					mtime: ntFiletimeToTime(info.LastWriteTime),
-				})
+			if parseErr != nil {
+				return nil, parseErr
 			}
-			if info.NextEntryOffset == 0 {
+			if !skip {
+				entries = append(entries, entry)
+			}
+			if nextEntryOffset == 0 {
 				break
 			}
-			offset += int(info.NextEntryOffset)
+			offset += int(nextEntryOffset)
 		}
 
 		if status == windows.STATUS_NO_MORE_FILES {
@@ -224,7 +322,59 @@ func enumerateDirectory(handle dirHandle) ([]dirEntry, error) {
 	return entries, nil
 }
 
-func ntQueryDirectory(handle dirHandle, buffer []byte, restart bool) (uint32, windows.NTStatus, error) {
+// decodeName reads a UTF-16 filename of nameBytes bytes starting at namePtr,
+// failing if it would run past the avail bytes remaining in the buffer.
+func decodeName(namePtr *uint16, nameBytes uint32, avail int) (string, error) {
+	if int(nameBytes) < 0 || int(nameBytes) > avail {
+		return "", fmt.Errorf("NtQueryDirectoryFile returned truncated data")
+	}
+	nameSlice := unsafe.Slice(namePtr, int(nameBytes)/2)
+	return string(utf16.Decode(nameSlice)), nil
+}
+
+func parseFullDirEntry(raw []byte) (dirEntry, bool, uint32, error) {
+	info := (*fileFullDirInformation)(unsafe.Pointer(&raw[0]))
+	name, err := decodeName(&info.FileName[0], info.FileNameLength, len(raw)-fileInfoHeaderSize)
+	if err != nil {
+		return dirEntry{}, false, 0, err
+	}
+	if name == "." || name == ".." {
+		return dirEntry{}, true, info.NextEntryOffset, nil
+	}
+	entry := dirEntry{
+		name:  name,
+		mode:  attributesToMode(info.FileAttributes),
+		size:  info.EndOfFile,
+		mtime: ntFiletimeToTime(info.LastWriteTime),
+		btime: ntFiletimeToTime(info.CreationTime),
+		ctime: ntFiletimeToTime(info.ChangeTime),
+	}
+	return entry, false, info.NextEntryOffset, nil
+}
+
+func parseIdExtdDirEntry(raw []byte) (dirEntry, bool, uint32, error) {
+	info := (*fileIdExtdDirInformation)(unsafe.Pointer(&raw[0]))
+	name, err := decodeName(&info.FileName[0], info.FileNameLength, len(raw)-fileIdExtdInfoHeaderSize)
+	if err != nil {
+		return dirEntry{}, false, 0, err
+	}
+	if name == "." || name == ".." {
+		return dirEntry{}, true, info.NextEntryOffset, nil
+	}
+	entry := dirEntry{
+		name:       name,
+		mode:       attributesToMode(info.FileAttributes),
+		size:       info.EndOfFile,
+		mtime:      ntFiletimeToTime(info.LastWriteTime),
+		btime:      ntFiletimeToTime(info.CreationTime),
+		ctime:      ntFiletimeToTime(info.ChangeTime),
+		ino:        binary.LittleEndian.Uint64(info.FileId[:8]),
+		reparseTag: info.ReparsePointTag,
+	}
+	return entry, false, info.NextEntryOffset, nil
+}
+
+func ntQueryDirectory(handle dirHandle, buffer []byte, restart bool, class int32) (uint32, windows.NTStatus, error) {
 	if len(buffer) == 0 {
 		return 0, 0, errDirBufferTooSmall
 	}
@@ -243,7 +393,7 @@ func ntQueryDirectory(handle dirHandle, buffer []byte, restart bool) (uint32, wi
 		uintptr(unsafe.Pointer(&iosb)),
 		uintptr(unsafe.Pointer(&buffer[0])),
 		uintptr(uint32(len(buffer))),
-		uintptr(fileFullDirectoryClass),
+		uintptr(class),
 		0,
 		0,
 		restartFlag,
@@ -258,6 +408,8 @@ func ntQueryDirectory(handle dirHandle, buffer []byte, restart bool) (uint32, wi
 		return uint32(iosb.Information), status, nil
 	case windows.STATUS_NO_MORE_FILES:
 		return 0, status, io.EOF
+	case windows.STATUS_INVALID_INFO_CLASS, windows.STATUS_NOT_SUPPORTED:
+		return 0, status, errDirClassUnsupported
 	default:
 		return 0, status, status.Errno()
 	}
@@ -273,6 +425,23 @@ func openRelativeDirectory(parent dirHandle, name string) (dirHandle, error) {
 			windows.FILE_OPEN_FOR_BACKUP_INTENT))
 }
 
+// openRelativeFile opens name relative to the already-open directory handle
+// dir, for handing off to the hash pool without re-resolving the path from
+// the volume root.
+func openRelativeFile(dir dirHandle, name string) (*os.File, error) {
+	handle, err := ntCreateRelative(
+		dir,
+		name,
+		windows.GENERIC_READ|windows.SYNCHRONIZE,
+		windows.FILE_ATTRIBUTE_NORMAL,
+		windows.FILE_NON_DIRECTORY_FILE|windows.FILE_SYNCHRONOUS_IO_NONALERT|windows.FILE_SEQUENTIAL_ONLY,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(handle), name), nil
+}
+
 func ntCreateRelative(parent dirHandle, name string, access uint32, attributes uint32, options uint32) (dirHandle, error) {
 	name16, err := windows.UTF16PtrFromString(name)
 	if err != nil {
@@ -310,6 +479,27 @@ func ntCreateRelative(parent dirHandle, name string, access uint32, attributes u
 	return handle, nil
 }
 
+// deviceID returns the volume serial number of the already-open directory
+// handle dir, for -xdev/-devices filesystem-boundary tracking.
+func deviceID(dir dirHandle) (uint64, error) {
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(dir, &info); err != nil {
+		return 0, fmt.Errorf("GetFileInformationByHandle failed: %w", err)
+	}
+	return uint64(info.VolumeSerialNumber), nil
+}
+
+// filesystemType reports the filesystem name (e.g. "NTFS") of the volume
+// containing the already-open directory handle dir.
+func filesystemType(dir dirHandle) (string, error) {
+	var fsName [windows.MAX_PATH + 1]uint16
+	err := windows.GetVolumeInformationByHandle(dir, nil, 0, nil, nil, nil, &fsName[0], uint32(len(fsName)))
+	if err != nil {
+		return "", fmt.Errorf("GetVolumeInformationByHandle failed: %w", err)
+	}
+	return windows.UTF16ToString(fsName[:]), nil
+}
+
 func attributesToMode(attrs uint32) os.FileMode {
 	if attrs&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
 		return os.ModeSymlink